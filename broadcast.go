@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// BroadcastManager tees the currently captured window to an external
+// RTMP/SRT sink while the browser keeps receiving it over WebRTC, following
+// neko's broadcast-manager pattern. It holds its own subscription to the
+// window's Capture (see capture.go) purely to keep the shared FFmpeg
+// pipeline alive for the duration of the broadcast; the actual tee is a
+// second output appended to that same pipeline, so a broadcast never costs
+// a second x11grab.
+type BroadcastManager struct {
+	mu         sync.Mutex
+	windowID   string
+	url        string
+	pipeline   *exec.Cmd // the Capture's ffmpeg process, kept here for status/introspection
+	pipelineFn func(url string) []string
+	frames     chan []byte
+}
+
+var broadcaster = &BroadcastManager{pipelineFn: defaultSinkArgs}
+
+// defaultSinkArgs builds the extra ffmpeg output args for a sink URL,
+// picking the container by scheme: flv for RTMP, mpegts for SRT.
+func defaultSinkArgs(url string) []string {
+	container := "flv"
+	if strings.HasPrefix(url, "srt://") {
+		container = "mpegts"
+	}
+	return []string{"-c:v", "libx264", "-preset", "veryfast", "-f", container, url}
+}
+
+// Start begins teeing windowID's capture pipeline to url. Only one
+// broadcast runs at a time, matching the single BroadcastManager singleton.
+func (b *BroadcastManager) Start(windowID, url string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.windowID != "" {
+		return fmt.Errorf("broadcast: already streaming window %s to %s", b.windowID, b.url)
+	}
+
+	sinkArgs := b.pipelineFn(url)
+
+	// Acquire seeds a not-yet-running pipeline with the tee args directly,
+	// and restarts an already-running one to pick them up — both decided
+	// atomically under the Capture's own lock, so there's no gap between
+	// "is it running" and "start/restart it" for a viewer's own Acquire to
+	// land in and leave the tee never attached.
+	_, frames, err := captures.Acquire(windowID, sinkArgs...)
+	if err != nil {
+		return fmt.Errorf("broadcast: %w", err)
+	}
+
+	b.windowID = windowID
+	b.url = url
+	b.frames = frames
+	b.pipeline = captures.Cmd(windowID)
+
+	// We don't need the frames ourselves (FFmpeg tees them directly into
+	// the sink); just drain the channel so the Capture's pump never blocks
+	// on us.
+	go func(ch chan []byte) {
+		for range ch {
+		}
+	}(frames)
+
+	log.Printf("📡 Broadcasting window %s to %s", windowID, url)
+	return nil
+}
+
+// Stop tears down the active broadcast, if any, restoring the window's
+// pipeline to its plain (non-teed) form.
+func (b *BroadcastManager) Stop() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.windowID == "" {
+		return fmt.Errorf("broadcast: nothing running")
+	}
+
+	captures.SetExtraOutput(b.windowID, nil)
+	captures.Release(b.windowID, b.frames)
+	log.Printf("📡 Broadcast stopped for window %s (%s)", b.windowID, b.url)
+
+	b.windowID = ""
+	b.url = ""
+	b.frames = nil
+	b.pipeline = nil
+	return nil
+}
+
+type broadcastRequest struct {
+	URL string `json:"url"`
+}
+
+// handleBroadcastStart serves POST /broadcast/start {"url":"rtmp://..."}.
+func handleBroadcastStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	windowID, err := resolveWindowID(r)
+	if err != nil {
+		http.Error(w, "Window not found", http.StatusBadRequest)
+		return
+	}
+
+	var req broadcastRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.URL == "" {
+		http.Error(w, "invalid broadcast request", http.StatusBadRequest)
+		return
+	}
+
+	if err := broadcaster.Start(windowID, req.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleBroadcastStop serves POST /broadcast/stop.
+func handleBroadcastStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := broadcaster.Stop(); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3/pkg/media/h264reader"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+)
+
+// h264AnnexBStartCode is prepended to every NAL pulled off h264reader (which
+// strips it while parsing) so the RTP payloader's own Annex-B scan in
+// pion/rtp's emitNalus sees a well-formed start code to split on.
+var h264AnnexBStartCode = []byte{0x00, 0x00, 0x00, 0x01}
+
+// captureCodec and captureBitrate control the FFmpeg encoder used for the
+// WebRTC pipeline. They are configurable via flags so the stream can be
+// tuned for the link it is served over.
+var (
+	captureCodec   string
+	captureBitrate string
+)
+
+// Capture owns a single FFmpeg x11grab pipeline for one window and fans its
+// encoded samples out to every subscriber. Only one Capture should ever run
+// per window ID at a time; CaptureManager enforces that with reference
+// counting so opening the viewer in two tabs doesn't start two pipelines.
+type Capture struct {
+	WindowID string
+	Width    int
+	Height   int
+
+	mu            sync.Mutex
+	cmd           *exec.Cmd
+	codec         string // "h264" or "vp8", set by start() so pump() knows how to frame samples
+	refCount      int
+	subs          map[chan []byte]struct{}
+	stopPoll      chan struct{}
+	broadcastArgs []string // extra ffmpeg output args for an active tee, see BroadcastManager
+}
+
+// CaptureManager is the process-wide singleton that keys captures by window
+// ID and reference-counts viewers, mirroring neko's BroadcastManager split
+// between "who wants frames" and "is the pipeline running".
+type CaptureManager struct {
+	mu       sync.Mutex
+	captures map[string]*Capture
+}
+
+var captures = &CaptureManager{captures: make(map[string]*Capture)}
+
+// Acquire starts (or reuses) the capture pipeline for windowID and returns a
+// channel that receives encoded frame payloads until Release is called.
+// extraArgs, if given, seeds the first start() directly, or triggers a
+// restart if a pipeline is already running without them (or with different
+// ones) — both decided under the Capture's own lock, so a caller never has
+// to snapshot "is it running" separately from this call the way
+// BroadcastManager.Start previously did, which raced against a viewer's own
+// Acquire starting the pipeline in between.
+func (m *CaptureManager) Acquire(windowID string, extraArgs ...string) (*Capture, chan []byte, error) {
+	m.mu.Lock()
+	c, ok := m.captures[windowID]
+	if !ok {
+		c = &Capture{WindowID: windowID, subs: make(map[chan []byte]struct{})}
+		m.captures[windowID] = c
+	}
+	m.mu.Unlock()
+
+	ch := make(chan []byte, 32)
+
+	c.mu.Lock()
+	c.subs[ch] = struct{}{}
+	c.refCount++
+	needStart := c.cmd == nil
+	needRestart := !needStart && len(extraArgs) > 0 && !sameArgs(c.broadcastArgs, extraArgs)
+	if len(extraArgs) > 0 {
+		c.broadcastArgs = extraArgs
+	}
+	c.mu.Unlock()
+
+	switch {
+	case needStart:
+		if err := c.start(); err != nil {
+			m.Release(windowID, ch)
+			return nil, nil, err
+		}
+	case needRestart:
+		c.stop()
+		if err := c.start(); err != nil {
+			m.Release(windowID, ch)
+			return nil, nil, err
+		}
+	}
+
+	return c, ch, nil
+}
+
+// sameArgs reports whether two ffmpeg extra-output arg slices are identical.
+func sameArgs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Release drops a subscriber and tears down the pipeline once nobody is
+// watching the window anymore.
+func (m *CaptureManager) Release(windowID string, ch chan []byte) {
+	m.mu.Lock()
+	c, ok := m.captures[windowID]
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	delete(c.subs, ch)
+	c.refCount--
+	remaining := c.refCount
+	c.mu.Unlock()
+	close(ch) // unblocks anyone still ranging over this subscriber's channel
+
+	if remaining <= 0 {
+		c.stop()
+		m.mu.Lock()
+		delete(m.captures, windowID)
+		m.mu.Unlock()
+	}
+}
+
+// SetExtraOutput sets (or clears, with nil) the extra ffmpeg output args
+// tacked onto windowID's pipeline, restarting it to pick up the change if
+// it's already running. Used by BroadcastManager to tee to an RTMP/SRT sink
+// without spawning a second x11grab.
+func (m *CaptureManager) SetExtraOutput(windowID string, args []string) error {
+	m.mu.Lock()
+	c, ok := m.captures[windowID]
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("capture: no active pipeline for window %s", windowID)
+	}
+
+	c.mu.Lock()
+	c.broadcastArgs = args
+	running := c.cmd != nil
+	c.mu.Unlock()
+
+	if running {
+		c.stop()
+		return c.start()
+	}
+	return nil
+}
+
+// Cmd returns the ffmpeg process currently backing windowID's pipeline, if
+// any, for callers that only need to observe it (e.g. BroadcastManager).
+func (m *CaptureManager) Cmd(windowID string) *exec.Cmd {
+	m.mu.Lock()
+	c, ok := m.captures[windowID]
+	m.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cmd
+}
+
+// start launches the FFmpeg pipeline for the window's current geometry and
+// begins polling xwininfo so the pipeline can be restarted on resize.
+func (c *Capture) start() error {
+	width, height, x, y, err := windowGeometry(c.WindowID)
+	if err != nil {
+		return fmt.Errorf("capture: %w", err)
+	}
+	c.Width, c.Height = width, height
+
+	codec := captureCodec
+	if codec == "" {
+		codec = "h264"
+	}
+	bitrate := captureBitrate
+	if bitrate == "" {
+		bitrate = "2M"
+	}
+
+	args := []string{
+		"-f", "x11grab",
+		"-video_size", fmt.Sprintf("%dx%d", width, height),
+		"-framerate", "30",
+		"-i", fmt.Sprintf(":99+%d,%d", x, y),
+		"-an",
+	}
+	switch codec {
+	case "vp8":
+		args = append(args, "-c:v", "libvpx", "-b:v", bitrate, "-deadline", "realtime", "-f", "ivf", "-")
+	default:
+		args = append(args, "-c:v", "libx264", "-preset", "ultrafast", "-tune", "zerolatency",
+			"-b:v", bitrate, "-pix_fmt", "yuv420p", "-f", "h264", "-")
+	}
+
+	// A broadcast tee, if one is active for this window, rides as a second
+	// output on the same ffmpeg invocation instead of a second x11grab.
+	c.mu.Lock()
+	args = append(args, c.broadcastArgs...)
+	c.mu.Unlock()
+
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Env = append(os.Environ(), "DISPLAY=:99")
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("capture: stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("capture: stderr pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("capture: start ffmpeg: %w", err)
+	}
+
+	c.mu.Lock()
+	c.cmd = cmd
+	c.codec = codec
+	c.stopPoll = make(chan struct{})
+	c.mu.Unlock()
+
+	log.Printf("📹 capture pipeline started for window %s (%dx%d, %s)", c.WindowID, width, height, codec)
+
+	go c.logStderr(stderr)
+	switch codec {
+	case "vp8":
+		go c.pumpVP8(stdout)
+	default:
+		go c.pumpH264(stdout)
+	}
+	go c.watchResize()
+
+	return nil
+}
+
+// pumpH264 reads FFmpeg's raw Annex-B stdout (-f h264) one NAL unit at a
+// time via h264reader and fans each out to every current subscriber,
+// dropping frames for any subscriber that is behind rather than blocking the
+// whole pipeline on a slow viewer. NALs commonly outgrow a single 32KB
+// Read(), so chunking on read boundaries (as a prior version of this
+// function did) corrupted the bitstream on almost every keyframe; h264reader
+// buffers across reads and only hands back whole NALs.
+func (c *Capture) pumpH264(stdout io.Reader) {
+	reader, err := h264reader.NewReader(stdout)
+	if err != nil {
+		log.Printf("FFmpeg(capture %s): h264reader: %v", c.WindowID, err)
+		return
+	}
+
+	for {
+		nal, err := reader.NextNAL()
+		if err != nil {
+			return
+		}
+
+		// h264reader strips the Annex-B start code while parsing; put it
+		// back so pion/rtp's own Annex-B scan has something to split on.
+		frame := make([]byte, 0, len(h264AnnexBStartCode)+len(nal.Data))
+		frame = append(frame, h264AnnexBStartCode...)
+		frame = append(frame, nal.Data...)
+
+		c.broadcast(frame)
+	}
+}
+
+// pumpVP8 reads FFmpeg's IVF container stdout (-f ivf) one frame at a time
+// via ivfreader and fans each raw VP8 payload out to every current
+// subscriber. Feeding the IVF bytes straight to pion's VP8 payloader (as a
+// prior version of this function did) handed it file/frame headers it has
+// no notion of; ivfreader strips both before returning a frame.
+func (c *Capture) pumpVP8(stdout io.Reader) {
+	reader, _, err := ivfreader.NewWith(stdout)
+	if err != nil {
+		log.Printf("FFmpeg(capture %s): ivfreader: %v", c.WindowID, err)
+		return
+	}
+
+	for {
+		frame, _, err := reader.ParseNextFrame()
+		if err != nil {
+			return
+		}
+		c.broadcast(frame)
+	}
+}
+
+// broadcast fans a single complete frame out to every current subscriber.
+func (c *Capture) broadcast(frame []byte) {
+	c.mu.Lock()
+	for ch := range c.subs {
+		select {
+		case ch <- frame:
+		default:
+		}
+	}
+	c.mu.Unlock()
+}
+
+func (c *Capture) logStderr(stderr io.Reader) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := stderr.Read(buf)
+		if n > 0 {
+			log.Printf("FFmpeg(capture %s): %s", c.WindowID, string(buf[:n]))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// watchResize polls xwininfo and restarts the pipeline whenever the window's
+// dimensions change, since x11grab can't follow a resizing source.
+func (c *Capture) watchResize() {
+	c.mu.Lock()
+	stop := c.stopPoll
+	c.mu.Unlock()
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			width, height, _, _, err := windowGeometry(c.WindowID)
+			if err != nil {
+				continue
+			}
+			c.mu.Lock()
+			changed := width != c.Width || height != c.Height
+			cmd := c.cmd
+			c.mu.Unlock()
+			if changed && cmd != nil {
+				log.Printf("🔁 window %s resized, restarting capture pipeline", c.WindowID)
+				c.stop()
+				if err := c.start(); err != nil {
+					log.Printf("❌ failed to restart capture pipeline: %v", err)
+				}
+				return
+			}
+		}
+	}
+}
+
+// stop kills the FFmpeg process and the resize poller for this capture.
+func (c *Capture) stop() {
+	c.mu.Lock()
+	cmd := c.cmd
+	stop := c.stopPoll
+	c.cmd = nil
+	c.stopPoll = nil
+	c.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	if cmd != nil && cmd.Process != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+}
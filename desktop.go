@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+)
+
+// InputMessage is the wire format for a single input event arriving over
+// the WebRTC data channel (or, later, the /input and /ws endpoints). Only
+// the fields relevant to Type are populated by the client.
+type InputMessage struct {
+	Type    string `json:"type"`    // "mouse" or "key"
+	X       int    `json:"x"`       // mouse: rendered-space X
+	Y       int    `json:"y"`       // mouse: rendered-space Y
+	Buttons int    `json:"buttons"` // mouse: bitmask, button 1 = left
+	Scroll  int    `json:"scroll"`  // mouse: wheel delta, positive = down
+	Code    string `json:"code"`    // key: X11 keysym name, e.g. "Return"
+	Action  string `json:"action"`  // key: "down" or "up"
+}
+
+// handleInputPayload decodes a raw data-channel message and injects it
+// against windowID, logging (rather than failing loudly) on bad input since
+// this runs off an untrusted, fire-and-forget channel.
+func handleInputPayload(windowID string, payload []byte) {
+	var msg InputMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		log.Printf("❌ Failed to decode input message: %v", err)
+		return
+	}
+	if err := injectInput(windowID, msg); err != nil {
+		log.Printf("❌ Failed to inject input: %v", err)
+	}
+}
+
+// injectInput turns a decoded InputMessage into the xdotool invocation that
+// performs it against windowID.
+func injectInput(windowID string, msg InputMessage) error {
+	switch msg.Type {
+	case "mouse":
+		return injectMouse(windowID, msg)
+	case "key":
+		return injectKey(windowID, msg)
+	default:
+		return fmt.Errorf("unknown input type %q", msg.Type)
+	}
+}
+
+func injectMouse(windowID string, msg InputMessage) error {
+	if err := runXdotool("mousemove", "--window", windowID, fmt.Sprintf("%d", msg.X), fmt.Sprintf("%d", msg.Y)); err != nil {
+		return err
+	}
+	if msg.Buttons != 0 {
+		if err := runXdotool("click", "--window", windowID, buttonArg(msg.Buttons)); err != nil {
+			return err
+		}
+	}
+	if msg.Scroll != 0 {
+		button := "5" // scroll down
+		if msg.Scroll < 0 {
+			button = "4" // scroll up
+		}
+		if err := runXdotool("click", "--window", windowID, button); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func injectKey(windowID string, msg InputMessage) error {
+	switch msg.Action {
+	case "down":
+		return runXdotool("keydown", "--window", windowID, msg.Code)
+	case "up":
+		return runXdotool("keyup", "--window", windowID, msg.Code)
+	default:
+		return fmt.Errorf("unknown key action %q", msg.Action)
+	}
+}
+
+// buttonArg maps the browser's MouseEvent.buttons bitmask to the xdotool
+// button index (1=left, 2=middle, 3=right).
+func buttonArg(buttons int) string {
+	switch {
+	case buttons&2 != 0:
+		return "3"
+	case buttons&4 != 0:
+		return "2"
+	default:
+		return "1"
+	}
+}
+
+func runXdotool(args ...string) error {
+	cmd := exec.Command("xdotool", args...)
+	cmd.Env = append(os.Environ(), "DISPLAY=:99")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("xdotool %v: %w (%s)", args, err, out)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// handleHLS serves the whole /hls/ tree: the master playlist, each quality's
+// own playlist, and its fMP4 segments, all backed by a per-window Manager.
+func handleHLS(w http.ResponseWriter, r *http.Request) {
+	windowID, err := resolveWindowID(r)
+	if err != nil {
+		http.Error(w, "Window not found", http.StatusBadRequest)
+		return
+	}
+
+	m, err := managerFor(windowID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/hls/")
+	if rest == "master.m3u8" {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		fmt.Fprint(w, m.masterPlaylist())
+		return
+	}
+
+	parts := strings.SplitN(rest, "/", 2)
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	quality, file := parts[0], parts[1]
+
+	if _, err := m.streamFor(quality); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	m.touch(quality)
+
+	switch {
+	case file == "index.m3u8":
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	case strings.HasSuffix(file, ".m4s"):
+		w.Header().Set("Content-Type", "video/iso.segment")
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	http.ServeFile(w, r, filepath.Join(hlsSegmentDir, windowID, quality, filepath.Base(file)))
+}
+
+// ensureHLSCacheDir creates the on-disk root for segment output if it
+// doesn't already exist, mirroring the thumbnail cache's setup.
+func ensureHLSCacheDir() error {
+	return os.MkdirAll(hlsSegmentDir, 0o755)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// authToken gates /input and /ws behind a bearer token. Empty disables
+// auth, which is the existing (insecure) default for local/dev use.
+var authToken string
+
+// inputRateLimit caps how many xdotool invocations a single window can
+// absorb per second, so a chatty or malicious client can't fork-bomb the
+// host via mousemove spam.
+const inputRateLimit = 60 // events/sec per window
+
+var wsUpgrader = websocket.Upgrader{
+	// The viewer is served from the same origin as the socket in every
+	// deployment this tool targets, so this stays permissive rather than
+	// forcing callers to pre-register an origin.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// rateLimiter is a minimal per-key token bucket, refilled once per second.
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	tokens map[string]int
+	reset  time.Time
+}
+
+func newRateLimiter(limit int) *rateLimiter {
+	return &rateLimiter{limit: limit, tokens: make(map[string]int), reset: time.Now()}
+}
+
+func (l *rateLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if time.Since(l.reset) >= time.Second {
+		l.tokens = make(map[string]int)
+		l.reset = time.Now()
+	}
+
+	if l.tokens[key] >= l.limit {
+		return false
+	}
+	l.tokens[key]++
+	return true
+}
+
+var inputLimiter = newRateLimiter(inputRateLimit)
+
+// requireAuth wraps a handler with bearer-token auth when --auth-token is
+// set; a no-op pass-through otherwise.
+func requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if authToken == "" {
+			next(w, r)
+			return
+		}
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if got == "" || got != authToken {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleInput serves POST /input: a single structured input event against
+// the window named in ?window=, rescaled by the caller to that window's
+// real geometry before it gets here.
+func handleInput(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	windowID, err := resolveWindowID(r)
+	if err != nil {
+		http.Error(w, "Window not found", http.StatusBadRequest)
+		return
+	}
+
+	if !inputLimiter.Allow(windowID) {
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	var msg InputMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, "invalid input message", http.StatusBadRequest)
+		return
+	}
+
+	if err := injectInput(windowID, msg); err != nil {
+		log.Printf("❌ Failed to inject input: %v", err)
+		http.Error(w, "injection failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleWS serves GET /ws: the same structured input events as /input, but
+// streamed continuously over a websocket's data channel for a single
+// window named in ?window= at connect time.
+func handleWS(w http.ResponseWriter, r *http.Request) {
+	windowID, err := resolveWindowID(r)
+	if err != nil {
+		http.Error(w, "Window not found", http.StatusBadRequest)
+		return
+	}
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("❌ WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	for {
+		var msg InputMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+
+		if !inputLimiter.Allow(windowID) {
+			continue
+		}
+		if err := injectInput(windowID, msg); err != nil {
+			log.Printf("❌ Failed to inject input: %v", err)
+		}
+	}
+}
@@ -13,16 +13,17 @@ import (
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 )
 
-// PageData holds data for the template
+// PageData holds data for the index/viewer templates.
 type PageData struct {
-	Title      string
-	WindowName string
+	Title   string
+	Windows []WindowInfo // index page: every visible window
+	Window  WindowInfo   // viewer page: the one being streamed
 }
 
 var tmpl *template.Template
-var windowName string
 
 func init() {
 	// Load template from file
@@ -36,21 +37,36 @@ func init() {
 
 func main() {
 	// Parse command line flags
-	flag.StringVar(&windowName, "window", "", "Name of the window to stream")
+	flag.StringVar(&captureCodec, "codec", "h264", "Video codec for the WebRTC pipeline (h264 or vp8)")
+	flag.StringVar(&captureBitrate, "bitrate", "2M", "Target bitrate for the WebRTC pipeline")
+	flag.StringVar(&thumbnailDir, "thumbnail-dir", "thumbnail-cache", "Directory to cache /snapshot thumbnails in")
+	flag.StringVar(&authToken, "auth-token", "", "Bearer token required on /input and /ws (disabled if empty)")
 	flag.Parse()
 
 	// Set up graceful shutdown
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
-	// List all available windows for debugging
-	listAllWindows()
+	// Populate the registry immediately and keep it fresh in the background
+	// instead of the old one-shot listAllWindows() debug dump.
+	registry.StartPolling(5 * time.Second)
 
-	// Serve the single page
-	http.HandleFunc("/", serveWindowStream)
+	http.HandleFunc("/", handleIndex)
+	http.HandleFunc("/w/", handleWindowRoute)
+	http.HandleFunc("/api/windows", handleAPIWindows)
+	http.HandleFunc("/offer", requireAuth(handleOffer))
+	http.HandleFunc("/hls/", handleHLS)
+	http.HandleFunc("/snapshot", requireAuth(handleSnapshot))
+	http.HandleFunc("/input", requireAuth(handleInput))
+	http.HandleFunc("/ws", requireAuth(handleWS))
+	http.HandleFunc("/broadcast/start", requireAuth(handleBroadcastStart))
+	http.HandleFunc("/broadcast/stop", requireAuth(handleBroadcastStop))
+
+	if err := ensureHLSCacheDir(); err != nil {
+		log.Fatalf("Failed to create HLS cache dir: %v", err)
+	}
 
 	fmt.Printf("🚀 Window Stream Server starting...\n")
-	fmt.Printf("🎯 Streaming window: %s\n", windowName)
 	fmt.Printf("🌐 Web interface: http://localhost:8181\n")
 
 	// Start HTTP server
@@ -63,66 +79,54 @@ func main() {
 	fmt.Println("\n👋 Shutting down server...")
 }
 
-func serveWindowStream(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path == "/stream" {
-		streamWindow(w, r)
+// handleIndex lists every visible window with a link into its viewer, the
+// multi-window replacement for the old single-window landing page.
+func handleIndex(w http.ResponseWriter, r *http.Request) {
+	data := PageData{
+		Title:   "iKVM Web Viewer",
+		Windows: registry.List(),
+	}
+	tmpl.Execute(w, data)
+}
+
+// handleWindowRoute dispatches everything under /w/<slug>/: the viewer page
+// at /w/<slug>/ and its MJPEG stream at /w/<slug>/stream.
+func handleWindowRoute(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/w/")
+	slug, sub, _ := strings.Cut(rest, "/")
+
+	info, ok := registry.BySlug(slug)
+	if !ok {
+		http.NotFound(w, r)
 		return
 	}
 
-	// Serve template
-	data := PageData{
-		Title:      windowName + " Stream",
-		WindowName: windowName,
+	switch sub {
+	case "", "/":
+		data := PageData{Title: info.Name + " Stream", Window: info}
+		tmpl.Execute(w, data)
+	case "stream":
+		streamWindow(w, r, info)
+	default:
+		http.NotFound(w, r)
 	}
-	tmpl.Execute(w, data)
 }
 
-func streamWindow(w http.ResponseWriter, r *http.Request) {
+func streamWindow(w http.ResponseWriter, r *http.Request, info WindowInfo) {
 	// Set headers for MJPEG stream
 	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=ffmpeg")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	w.Header().Set("Connection", "close")
 	w.Header().Set("Pragma", "no-cache")
 
-	// Find the specified window
-	windowID, err := findWindow()
-	if err != nil {
-		log.Printf("❌ Failed to find window: %v", err)
-		http.Error(w, "Window not found", http.StatusInternalServerError)
-		return
-	}
-
-	// Get window position and size
-	posCmd := exec.Command("sh", "-c", fmt.Sprintf("DISPLAY=:99 xwininfo -id %s | grep -E 'Absolute|Width|Height'", windowID))
-	posOutput, err := posCmd.Output()
+	width, height, x, y, err := windowGeometry(info.ID)
 	if err != nil {
-		log.Printf("❌ Failed to get window position: %v", err)
-		http.Error(w, "Failed to get window position", http.StatusInternalServerError)
-		return
-	}
-
-	// Parse window position and size
-	posLines := strings.Split(string(posOutput), "\n")
-	var x, y, width, height int
-	for _, line := range posLines {
-		if strings.Contains(line, "Absolute upper-left X:") {
-			fmt.Sscanf(line, "  Absolute upper-left X:  %d", &x)
-		} else if strings.Contains(line, "Absolute upper-left Y:") {
-			fmt.Sscanf(line, "  Absolute upper-left Y:  %d", &y)
-		} else if strings.Contains(line, "Width:") {
-			fmt.Sscanf(line, "  Width: %d", &width)
-		} else if strings.Contains(line, "Height:") {
-			fmt.Sscanf(line, "  Height: %d", &height)
-		}
-	}
-
-	if width == 0 || height == 0 {
-		log.Printf("❌ Failed to parse window dimensions")
-		http.Error(w, "Failed to get window dimensions", http.StatusInternalServerError)
+		log.Printf("❌ Failed to get window geometry: %v", err)
+		http.Error(w, "Failed to get window geometry", http.StatusInternalServerError)
 		return
 	}
 
-	// Use FFmpeg to capture Firefox window with high quality settings
+	// Use FFmpeg to capture the window with high quality settings
 	cmd := exec.Command("ffmpeg",
 		"-f", "x11grab",
 		"-video_size", fmt.Sprintf("%dx%d", width, height),
@@ -159,7 +163,7 @@ func streamWindow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fmt.Printf("📹 %s stream started\n", windowName)
+	fmt.Printf("📹 %s stream started\n", info.Name)
 
 	// Log command output in background
 	go func() {
@@ -175,7 +179,7 @@ func streamWindow(w http.ResponseWriter, r *http.Request) {
 			cmd.Process.Kill()
 			cmd.Wait()
 		}
-		fmt.Printf("📹 %s stream stopped\n", windowName)
+		fmt.Printf("📹 %s stream stopped\n", info.Name)
 	}()
 
 	// Stream the data directly to the client
@@ -202,49 +206,50 @@ func streamWindow(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func listAllWindows() {
-	// Get all visible windows
-	cmd := exec.Command("sh", "-c", "DISPLAY=:99 xdotool search --onlyvisible --name . 2>/dev/null || echo ''")
+// findWindowByName searches for a visible window by name directly via
+// xdotool. Used for requests that haven't been routed through the registry
+// yet (e.g. a /snapshot?window= call for a name rather than a slug).
+func findWindowByName(name string) (string, error) {
+	cmd := exec.Command("xdotool", "search", "--onlyvisible", "--name", name)
+	cmd.Env = append(os.Environ(), "DISPLAY=:99")
 	output, err := cmd.Output()
 	if err != nil || len(output) == 0 {
-		fmt.Println("❌ No windows found")
-		return
+		return "", fmt.Errorf("no window matching '%s' found", name)
 	}
 
-	// Get window IDs
 	windowIDs := strings.Split(strings.TrimSpace(string(output)), "\n")
 	if len(windowIDs) == 0 || windowIDs[0] == "" {
-		fmt.Println("❌ No windows found")
-		return
+		return "", fmt.Errorf("no window matching '%s' found", name)
 	}
 
-	fmt.Println("🔍 Available windows:")
-	for _, id := range windowIDs {
-		// Get window name
-		nameCmd := exec.Command("sh", "-c", fmt.Sprintf("DISPLAY=:99 xdotool getwindowname %s 2>/dev/null || echo 'Unknown'", id))
-		nameOutput, err := nameCmd.Output()
-		name := "Unknown"
-		if err == nil {
-			name = strings.TrimSpace(string(nameOutput))
-		}
-		fmt.Printf("   - [%s] %s\n", id, name)
-	}
-	fmt.Println()
+	return windowIDs[0], nil
 }
 
-func findWindow() (string, error) {
-	// Search for the specified window
-	cmd := exec.Command("sh", "-c", fmt.Sprintf("DISPLAY=:99 xdotool search --onlyvisible --name '%s' 2>/dev/null || echo ''", windowName))
+// windowGeometry returns the width, height and absolute top-left position of
+// a window, as reported by xwininfo. Shared by the MJPEG path and the
+// WebRTC capture pipeline so the two never disagree about where to grab.
+func windowGeometry(windowID string) (width, height, x, y int, err error) {
+	cmd := exec.Command("sh", "-c", fmt.Sprintf("DISPLAY=:99 xwininfo -id %s | grep -E 'Absolute|Width|Height'", windowID))
 	output, err := cmd.Output()
-	if err != nil || len(output) == 0 {
-		return "", fmt.Errorf("no window matching '%s' found", windowName)
+	if err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("failed to get window position: %w", err)
 	}
 
-	// Get the first window ID
-	windowIDs := strings.Split(strings.TrimSpace(string(output)), "\n")
-	if len(windowIDs) == 0 || windowIDs[0] == "" {
-		return "", fmt.Errorf("no window matching '%s' found", windowName)
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.Contains(line, "Absolute upper-left X:") {
+			fmt.Sscanf(line, "  Absolute upper-left X:  %d", &x)
+		} else if strings.Contains(line, "Absolute upper-left Y:") {
+			fmt.Sscanf(line, "  Absolute upper-left Y:  %d", &y)
+		} else if strings.Contains(line, "Width:") {
+			fmt.Sscanf(line, "  Width: %d", &width)
+		} else if strings.Contains(line, "Height:") {
+			fmt.Sscanf(line, "  Height: %d", &height)
+		}
 	}
 
-	return windowIDs[0], nil
+	if width == 0 || height == 0 {
+		return 0, 0, 0, 0, fmt.Errorf("failed to parse window dimensions")
+	}
+
+	return width, height, x, y, nil
 }
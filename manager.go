@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// hlsRung describes one rung of the quality ladder.
+type hlsRung struct {
+	Name    string // e.g. "360p", used in the URL
+	Height  int
+	Bitrate string
+}
+
+// hlsLadder is the full set of rungs the manager will try to serve. Rungs
+// taller than the captured window are skipped at Manager creation time.
+var hlsLadder = []hlsRung{
+	{Name: "360p", Height: 360, Bitrate: "800k"},
+	{Name: "480p", Height: 480, Bitrate: "1400k"},
+	{Name: "720p", Height: 720, Bitrate: "2800k"},
+	{Name: "1080p", Height: 1080, Bitrate: "5000k"},
+}
+
+// hlsInactiveTimeout is how long a Stream is left running with no segment
+// requests before it is torn down.
+var hlsInactiveTimeout = 30 * time.Second
+
+// hlsSegmentDir is where fMP4 segments are written, one subdirectory per
+// window+quality.
+var hlsSegmentDir = "hls-cache"
+
+// Manager owns every Stream for a single window, modeled on go-vod's
+// Manager/Stream split: the Manager knows the source geometry and which
+// rungs are viable, each Stream owns one quality's FFmpeg encoder.
+type Manager struct {
+	WindowID string
+	Width    int
+	Height   int
+
+	mu      sync.Mutex
+	streams map[string]*Stream
+	done    chan struct{} // closed once the Manager itself is torn down
+}
+
+// Stream is a single-quality fMP4 encoder plus its inactivity tracker.
+type Stream struct {
+	Quality  string
+	dir      string
+	cmd      *exec.Cmd
+	inactive int32 // seconds since last segment request, ticked by Manager
+}
+
+var managers = struct {
+	mu sync.Mutex
+	m  map[string]*Manager
+}{m: make(map[string]*Manager)}
+
+// managerFor returns (creating if necessary) the Manager for windowID,
+// probing its geometry with ffprobe the first time it's requested.
+func managerFor(windowID string) (*Manager, error) {
+	managers.mu.Lock()
+	defer managers.mu.Unlock()
+
+	if m, ok := managers.m[windowID]; ok {
+		return m, nil
+	}
+
+	width, height, _, _, err := windowGeometry(windowID)
+	if err != nil {
+		return nil, fmt.Errorf("manager: %w", err)
+	}
+
+	m := &Manager{
+		WindowID: windowID,
+		Width:    width,
+		Height:   height,
+		streams:  make(map[string]*Stream),
+		done:     make(chan struct{}),
+	}
+	managers.m[windowID] = m
+	go m.reapLoop()
+
+	log.Printf("🎚️  HLS manager created for window %s (%dx%d)", windowID, width, height)
+	return m, nil
+}
+
+// rungs returns the ladder entries that fit within the captured window.
+func (m *Manager) rungs() []hlsRung {
+	var out []hlsRung
+	for _, r := range hlsLadder {
+		if r.Height <= m.Height {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// rung looks up a single ladder entry by name, honoring the height cap.
+func (m *Manager) rung(quality string) (hlsRung, bool) {
+	for _, r := range m.rungs() {
+		if r.Name == quality {
+			return r, true
+		}
+	}
+	return hlsRung{}, false
+}
+
+// streamFor starts (or reuses) the Stream for a quality rung.
+func (m *Manager) streamFor(quality string) (*Stream, error) {
+	rung, ok := m.rung(quality)
+	if !ok {
+		return nil, fmt.Errorf("manager: quality %q not available for this window", quality)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.streams[quality]; ok {
+		return s, nil
+	}
+
+	dir := filepath.Join(hlsSegmentDir, m.WindowID, quality)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("manager: create segment dir: %w", err)
+	}
+
+	_, _, x, y, err := windowGeometry(m.WindowID)
+	if err != nil {
+		return nil, fmt.Errorf("manager: %w", err)
+	}
+
+	cmd := exec.Command("ffmpeg",
+		"-f", "x11grab",
+		"-video_size", fmt.Sprintf("%dx%d", m.Width, m.Height),
+		"-framerate", "30",
+		"-i", fmt.Sprintf(":99+%d,%d", x, y),
+		"-vf", fmt.Sprintf("scale=-2:%d", rung.Height),
+		"-c:v", "libx264", "-preset", "veryfast", "-b:v", rung.Bitrate,
+		"-f", "hls",
+		"-hls_segment_type", "fmp4",
+		"-hls_flags", "independent_segments",
+		"-hls_segment_filename", filepath.Join(dir, "chunk-%d.m4s"),
+		filepath.Join(dir, "index.m3u8"),
+	)
+	cmd.Env = append(os.Environ(), "DISPLAY=:99")
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("manager: stderr pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("manager: start ffmpeg: %w", err)
+	}
+
+	s := &Stream{Quality: quality, dir: dir, cmd: cmd}
+	m.streams[quality] = s
+
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := stderr.Read(buf)
+			if n > 0 {
+				log.Printf("FFmpeg(hls %s/%s): %s", m.WindowID, quality, string(buf[:n]))
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	log.Printf("🎞️  HLS stream started: window=%s quality=%s", m.WindowID, quality)
+	return s, nil
+}
+
+// touch resets a stream's inactivity counter; call it whenever a segment or
+// playlist for that quality is served.
+func (m *Manager) touch(quality string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.streams[quality]; ok {
+		s.inactive = 0
+	}
+}
+
+// reapLoop ticks every second, ages every stream's inactivity counter, and
+// tears down any stream that's been idle past hlsInactiveTimeout. It exits
+// once the Manager itself has been torn down by stopStream.
+func (m *Manager) reapLoop() {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.mu.Lock()
+			var stale []string
+			for quality, s := range m.streams {
+				s.inactive++
+				if time.Duration(s.inactive)*time.Second >= hlsInactiveTimeout {
+					stale = append(stale, quality)
+				}
+			}
+			m.mu.Unlock()
+
+			for _, quality := range stale {
+				m.stopStream(quality)
+			}
+		}
+	}
+}
+
+// stopStream kills a stream's FFmpeg encoder and removes it from the
+// manager. If that was the last stream, it also tears the whole Manager down
+// from the top-level registry so a window nobody is watching anymore doesn't
+// leave its reapLoop ticking forever. The empty check and the registry
+// deletion happen under the same m.mu section as the removal itself (rather
+// than being signaled to a separate watcher goroutine over a channel) so a
+// concurrent streamFor() can't slip a new Stream in between the check and
+// the teardown.
+func (m *Manager) stopStream(quality string) {
+	m.mu.Lock()
+	s, ok := m.streams[quality]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.streams, quality)
+	empty := len(m.streams) == 0
+	if empty {
+		managers.mu.Lock()
+		if managers.m[m.WindowID] == m {
+			delete(managers.m, m.WindowID)
+		}
+		managers.mu.Unlock()
+	}
+	m.mu.Unlock()
+
+	if s.cmd != nil && s.cmd.Process != nil {
+		s.cmd.Process.Kill()
+		s.cmd.Wait()
+	}
+	log.Printf("🛑 HLS stream stopped: window=%s quality=%s (idle %s)", m.WindowID, quality, hlsInactiveTimeout)
+
+	if empty {
+		close(m.done)
+		log.Printf("🎚️  HLS manager torn down for window %s (idle)", m.WindowID)
+	}
+}
+
+// masterPlaylist lists only the rungs currently running.
+func (m *Manager) masterPlaylist() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := "#EXTM3U\n#EXT-X-VERSION:7\n"
+	for _, r := range hlsLadder {
+		if _, ok := m.streams[r.Name]; !ok {
+			continue
+		}
+		out += fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%s,RESOLUTION=%dx%d\n%s/index.m3u8\n",
+			bitrateToBPS(r.Bitrate), r.Height*16/9, r.Height, r.Name)
+	}
+	return out
+}
+
+// bitrateToBPS converts an FFmpeg-style bitrate string ("800k") to a plain
+// bits-per-second number for the HLS BANDWIDTH attribute.
+func bitrateToBPS(s string) string {
+	n := len(s)
+	if n == 0 {
+		return "0"
+	}
+	mult := 1
+	switch s[n-1] {
+	case 'k', 'K':
+		mult = 1000
+		s = s[:n-1]
+	case 'm', 'M':
+		mult = 1000000
+		s = s[:n-1]
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return "0"
+	}
+	return strconv.Itoa(v * mult)
+}
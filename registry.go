@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WindowInfo is the public, JSON-serializable view of one tracked window.
+type WindowInfo struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Slug   string `json:"slug"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// WindowRegistry replaces the old single -window flag / windowName global:
+// it periodically rescans xdotool for every visible window and exposes each
+// one at a stable slug so the viewer can address many windows at once.
+type WindowRegistry struct {
+	mu      sync.RWMutex
+	windows map[string]WindowInfo // keyed by slug
+}
+
+var registry = &WindowRegistry{windows: make(map[string]WindowInfo)}
+
+// StartPolling scans immediately, then rescans every interval in the
+// background for as long as the process runs.
+func (r *WindowRegistry) StartPolling(interval time.Duration) {
+	r.scan()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			r.scan()
+		}
+	}()
+}
+
+// scan lists every visible window via xdotool and replaces the registry's
+// contents with what's currently on screen.
+func (r *WindowRegistry) scan() {
+	cmd := exec.Command("sh", "-c", "DISPLAY=:99 xdotool search --onlyvisible --name . 2>/dev/null || echo ''")
+	output, err := cmd.Output()
+	if err != nil {
+		log.Printf("❌ WindowRegistry scan failed: %v", err)
+		return
+	}
+
+	ids := strings.Fields(strings.TrimSpace(string(output)))
+	found := make(map[string]WindowInfo, len(ids))
+	seenBase := make(map[string]int)
+
+	for _, id := range ids {
+		name, err := windowTitle(id)
+		if err != nil {
+			continue
+		}
+		width, height, x, y, err := windowGeometry(id)
+		if err != nil {
+			continue
+		}
+
+		base := slugify(name)
+		slug := base
+		if n := seenBase[base]; n > 0 {
+			slug = fmt.Sprintf("%s-%d", base, n+1)
+		}
+		seenBase[base]++
+
+		found[slug] = WindowInfo{ID: id, Name: name, Slug: slug, X: x, Y: y, Width: width, Height: height}
+	}
+
+	r.mu.Lock()
+	r.windows = found
+	r.mu.Unlock()
+}
+
+// List returns every currently visible window, sorted by slug for a stable
+// index page ordering.
+func (r *WindowRegistry) List() []WindowInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]WindowInfo, 0, len(r.windows))
+	for _, w := range r.windows {
+		out = append(out, w)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Slug < out[j].Slug })
+	return out
+}
+
+// BySlug looks up a single window by its slug.
+func (r *WindowRegistry) BySlug(slug string) (WindowInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	w, ok := r.windows[slug]
+	return w, ok
+}
+
+var slugInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify turns a window title into a stable, URL-safe slug.
+func slugify(name string) string {
+	s := slugInvalid.ReplaceAllString(strings.ToLower(name), "-")
+	s = strings.Trim(s, "-")
+	if s == "" {
+		return "window"
+	}
+	return s
+}
+
+func windowTitle(id string) (string, error) {
+	cmd := exec.Command("sh", "-c", fmt.Sprintf("DISPLAY=:99 xdotool getwindowname %s 2>/dev/null", id))
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get window name for %s: %w", id, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// handleAPIWindows serves GET /api/windows, the JSON index used by the
+// dashboard and by anything polling for live window geometry.
+func handleAPIWindows(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(registry.List())
+}
+
+// resolveWindowID finds the target window for a request that isn't scoped
+// under /w/<slug>/, accepting either a registry slug or a raw window name
+// in the ?window= query parameter.
+func resolveWindowID(r *http.Request) (string, error) {
+	q := r.URL.Query().Get("window")
+	if q == "" {
+		return "", fmt.Errorf("window parameter required")
+	}
+	if info, ok := registry.BySlug(q); ok {
+		return info.ID, nil
+	}
+	return findWindowByName(q)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+// frameDuration is the nominal sample duration handed to pion for each
+// encoded chunk, matching the 30fps capture rate in capture.go.
+const frameDuration = time.Second / 30
+
+// handleOffer negotiates a WebRTC session for the currently configured
+// window: it takes the browser's SDP offer, attaches the window's capture
+// pipeline to a TrackLocalStaticSample, wires the data channel to desktop
+// input injection, and answers with our SDP.
+func handleOffer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var offer webrtc.SessionDescription
+	if err := json.NewDecoder(r.Body).Decode(&offer); err != nil {
+		log.Printf("❌ Failed to decode SDP offer: %v", err)
+		http.Error(w, "Invalid offer", http.StatusBadRequest)
+		return
+	}
+
+	windowID, err := resolveWindowID(r)
+	if err != nil {
+		log.Printf("❌ Failed to find window: %v", err)
+		http.Error(w, "Window not found", http.StatusBadRequest)
+		return
+	}
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		log.Printf("❌ Failed to create peer connection: %v", err)
+		http.Error(w, "WebRTC setup failed", http.StatusInternalServerError)
+		return
+	}
+
+	mimeType := webrtc.MimeTypeH264
+	if captureCodec == "vp8" {
+		mimeType = webrtc.MimeTypeVP8
+	}
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: mimeType}, "video", "ikvm")
+	if err != nil {
+		log.Printf("❌ Failed to create video track: %v", err)
+		http.Error(w, "WebRTC setup failed", http.StatusInternalServerError)
+		return
+	}
+	if _, err := pc.AddTrack(track); err != nil {
+		log.Printf("❌ Failed to attach video track: %v", err)
+		http.Error(w, "WebRTC setup failed", http.StatusInternalServerError)
+		return
+	}
+
+	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+		dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+			if !inputLimiter.Allow(windowID) {
+				return
+			}
+			handleInputPayload(windowID, msg.Data)
+		})
+	})
+
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		log.Printf("🔌 WebRTC connection state for window %s: %s", windowID, state)
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			pc.Close()
+		}
+	})
+
+	if err := pc.SetRemoteDescription(offer); err != nil {
+		log.Printf("❌ Failed to set remote description: %v", err)
+		http.Error(w, "WebRTC negotiation failed", http.StatusInternalServerError)
+		return
+	}
+
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		log.Printf("❌ Failed to create SDP answer: %v", err)
+		http.Error(w, "WebRTC negotiation failed", http.StatusInternalServerError)
+		return
+	}
+	if err := pc.SetLocalDescription(answer); err != nil {
+		log.Printf("❌ Failed to set local description: %v", err)
+		http.Error(w, "WebRTC negotiation failed", http.StatusInternalServerError)
+		return
+	}
+
+	go feedTrack(windowID, track, pc)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pc.LocalDescription())
+}
+
+// feedTrack acquires the shared capture pipeline for windowID and writes
+// every encoded sample into track until the peer connection goes away.
+func feedTrack(windowID string, track *webrtc.TrackLocalStaticSample, pc *webrtc.PeerConnection) {
+	_, frames, err := captures.Acquire(windowID)
+	if err != nil {
+		log.Printf("❌ Failed to acquire capture for window %s: %v", windowID, err)
+		pc.Close()
+		return
+	}
+	defer captures.Release(windowID, frames)
+
+	for frame := range frames {
+		if pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			return
+		}
+		if err := track.WriteSample(media.Sample{Data: frame, Duration: frameDuration}); err != nil {
+			log.Printf("❌ Failed to write sample for window %s: %v", windowID, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// thumbnailDir is where encoded snapshots are cached, configurable via
+// --thumbnail-dir so dashboards polling many tiles don't pay FFmpeg per
+// request.
+var thumbnailDir string
+
+// thumbnailBucket is the width of the mtime bucket used in cache keys, so a
+// window that's actively changing still gets a fresh thumbnail periodically
+// without busting the cache on every single request.
+const thumbnailBucket = 5 * time.Second
+
+// maxSnapshotDimension caps w/h so a client can't spray unique sizes to
+// defeat the mtime-bucket cache key and force unbounded concurrent FFmpeg
+// spawns and thumbnail-dir writes.
+const maxSnapshotDimension = 2000
+
+// handleSnapshot serves GET /snapshot?window=<name>&w=320&h=200&fmt=webp|jpeg,
+// capturing a single frame with FFmpeg and caching the encoded result on
+// disk, mirroring the webfs thumbnail approach.
+func handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	width, err := parseDimension(r.URL.Query().Get("w"), 320)
+	if err != nil {
+		http.Error(w, "invalid w", http.StatusBadRequest)
+		return
+	}
+	height, err := parseDimension(r.URL.Query().Get("h"), 200)
+	if err != nil {
+		http.Error(w, "invalid h", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("fmt")
+	switch format {
+	case "", "jpeg":
+		format = "jpeg"
+	case "webp":
+		// ok
+	default:
+		http.Error(w, "fmt must be jpeg or webp", http.StatusBadRequest)
+		return
+	}
+
+	windowID, err := resolveWindowID(r)
+	if err != nil {
+		http.Error(w, "Window not found", http.StatusBadRequest)
+		return
+	}
+
+	if !inputLimiter.Allow(windowID) {
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	cachePath, err := snapshotCachePath(windowID, width, height, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := os.Stat(cachePath); err != nil {
+		if err := captureSnapshot(windowID, width, height, format, cachePath); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", mimeForFormat(format))
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(thumbnailBucket.Seconds())))
+	http.ServeFile(w, r, cachePath)
+}
+
+// snapshotCachePath builds the on-disk cache key: window_id + size + fmt +
+// an mtime bucket for the window, so a static window reuses the same file
+// and a changing one still refreshes every thumbnailBucket.
+func snapshotCachePath(windowID string, width, height int, format string) (string, error) {
+	bucket := time.Now().Truncate(thumbnailBucket).Unix()
+	key := fmt.Sprintf("%s_%dx%d_%s_%d.%s", windowID, width, height, format, bucket, format)
+	return filepath.Join(thumbnailDir, key), nil
+}
+
+// captureSnapshot grabs a single frame of windowID, scaled to fit within
+// width x height, and writes the encoded result to dest.
+func captureSnapshot(windowID string, width, height int, format, dest string) error {
+	if err := os.MkdirAll(thumbnailDir, 0o755); err != nil {
+		return fmt.Errorf("snapshot: create cache dir: %w", err)
+	}
+
+	w, h, x, y, err := windowGeometry(windowID)
+	if err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+
+	cmd := exec.Command("ffmpeg",
+		"-f", "x11grab",
+		"-video_size", fmt.Sprintf("%dx%d", w, h),
+		"-i", fmt.Sprintf(":99+%d,%d", x, y),
+		"-vframes", "1",
+		"-vf", fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", width, height),
+		"-y", dest,
+	)
+	cmd.Env = append(os.Environ(), "DISPLAY=:99")
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("snapshot: ffmpeg failed: %w (%s)", err, out)
+	}
+	return nil
+}
+
+func parseDimension(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v <= 0 || v > maxSnapshotDimension {
+		return 0, fmt.Errorf("invalid dimension %q", s)
+	}
+	return v, nil
+}
+
+func mimeForFormat(format string) string {
+	if format == "webp" {
+		return "image/webp"
+	}
+	return "image/jpeg"
+}